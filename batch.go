@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type RenderDiagramsBatchInput struct {
+	Items []DownloadDiagramInput `json:"items" jsonschema:"Diagrams to render, one per item, using the same fields as download_diagram."`
+}
+
+type BatchRenderResult struct {
+	OutputPath string `json:"outputPath"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+}
+
+type RenderDiagramsBatchOutput struct {
+	Results   []BatchRenderResult `json:"results"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+}
+
+// RenderDiagramsBatch returns the render_diagrams_batch tool handler bound
+// to krokiServer (see GenerateDiagramURL in main.go), so the worker
+// goroutines below share its http.Client's connection pool.
+func RenderDiagramsBatch(krokiServer *KrokiServer) func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[RenderDiagramsBatchInput]) (*mcp.CallToolResultFor[RenderDiagramsBatchOutput], error) {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[RenderDiagramsBatchInput]) (*mcp.CallToolResultFor[RenderDiagramsBatchOutput], error) {
+		items := params.Arguments.Items
+
+		results := make([]BatchRenderResult, len(items))
+		semaphore := make(chan struct{}, batchConcurrency())
+		var wg sync.WaitGroup
+
+		for i, item := range items {
+			wg.Add(1)
+			go func(i int, item DownloadDiagramInput) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				if err := krokiServer.downloadDiagram(ctx, item); err != nil {
+					results[i] = BatchRenderResult{OutputPath: item.OutputPath, Success: false, Error: err.Error()}
+					return
+				}
+				results[i] = BatchRenderResult{OutputPath: item.OutputPath, Success: true}
+			}(i, item)
+		}
+
+		wg.Wait()
+
+		succeeded, failed := 0, 0
+		for _, r := range results {
+			if r.Success {
+				succeeded++
+			} else {
+				failed++
+			}
+		}
+
+		return &mcp.CallToolResultFor[RenderDiagramsBatchOutput]{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Rendered %d diagram(s): %d succeeded, %d failed.", len(items), succeeded, failed)}},
+			StructuredContent: RenderDiagramsBatchOutput{
+				Results:   results,
+				Succeeded: succeeded,
+				Failed:    failed,
+			},
+		}, nil
+	}
+}
+
+// batchConcurrency returns the worker pool size for render_diagrams_batch,
+// controlled by KROKI_MAX_CONCURRENCY and defaulting to GOMAXPROCS.
+func batchConcurrency() int {
+	if raw := os.Getenv("KROKI_MAX_CONCURRENCY"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return runtime.GOMAXPROCS(0)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultCacheTTL      = 24 * time.Hour
+	defaultCacheMaxBytes = 512 * 1024 * 1024 // 512 MiB
+	defaultCacheDirName  = "mcp-kroki-go"
+	cacheEnabledEnvVar   = "KROKI_CACHE_ENABLED"
+	cacheDirEnvVar       = "KROKI_CACHE_DIR"
+	cacheTTLEnvVar       = "KROKI_CACHE_TTL"
+	cacheMaxBytesEnvVar  = "KROKI_CACHE_MAX_BYTES"
+)
+
+// Cache stores previously rendered diagram bytes so repeated calls with the
+// same (diagramType, content, outputFormat, scale, options) don't re-hit Kroki.
+type Cache interface {
+	Get(key, ext string) ([]byte, bool)
+	Put(key, ext string, data []byte) error
+	Clear() error
+}
+
+// FileCache is the default Cache implementation, rooted at a directory on
+// disk and evicted by TTL and total size (oldest mtime first).
+type FileCache struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+}
+
+// NewFileCache builds a FileCache rooted at dir, creating it if necessary.
+func NewFileCache(dir string, ttl time.Duration, maxBytes int64) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+	return &FileCache{dir: dir, ttl: ttl, maxBytes: maxBytes}, nil
+}
+
+func (c *FileCache) path(key, ext string) string {
+	return filepath.Join(c.dir, key+"."+ext)
+}
+
+func (c *FileCache) Get(key, ext string) ([]byte, bool) {
+	path := c.path(key, ext)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+		os.Remove(path)
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *FileCache) Put(key, ext string, data []byte) error {
+	if err := os.WriteFile(c.path(key, ext), data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return c.evict()
+}
+
+func (c *FileCache) Clear() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory %s: %w", c.dir, err)
+	}
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(c.dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove cache entry %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// evict removes the least-recently-modified entries until the cache
+// directory is back under maxBytes.
+func (c *FileCache) evict() error {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory %s: %w", c.dir, err)
+	}
+
+	type fileInfo struct {
+		name  string
+		size  int64
+		mtime time.Time
+	}
+
+	files := make([]fileInfo, 0, len(entries))
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, fileInfo{name: entry.Name(), size: info.Size(), mtime: info.ModTime()})
+		total += info.Size()
+	}
+
+	if total <= c.maxBytes {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].mtime.Before(files[j].mtime) })
+
+	for _, f := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.name)); err != nil {
+			continue
+		}
+		total -= f.size
+	}
+
+	return nil
+}
+
+// cacheKey derives a stable filename-safe key from the inputs that affect
+// the rendered output of a diagram.
+func cacheKey(diagramType, outputFormat string, scale, dpi float64, resample, content string, options map[string]any) string {
+	optionsJSON, _ := json.Marshal(options)
+	payload := fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s", diagramType, outputFormat, strconv.FormatFloat(scale, 'f', -1, 64), strconv.FormatFloat(dpi, 'f', -1, 64), resample, content, optionsJSON)
+	sum := sha256.Sum256([]byte(payload))
+	return fmt.Sprintf("%x", sum)
+}
+
+// newCacheFromEnv builds the default Cache from environment toggles, or
+// returns nil when caching is disabled.
+func newCacheFromEnv() (Cache, error) {
+	if raw := os.Getenv(cacheEnabledEnvVar); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err == nil && !enabled {
+			return nil, nil
+		}
+	}
+
+	dir := os.Getenv(cacheDirEnvVar)
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve default cache directory: %w", err)
+		}
+		dir = filepath.Join(userCacheDir, defaultCacheDirName)
+	}
+
+	ttl := defaultCacheTTL
+	if raw := os.Getenv(cacheTTLEnvVar); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil {
+			ttl = parsed
+		}
+	}
+
+	maxBytes := int64(defaultCacheMaxBytes)
+	if raw := os.Getenv(cacheMaxBytesEnvVar); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil && parsed > 0 {
+			maxBytes = parsed
+		}
+	}
+
+	return NewFileCache(dir, ttl, maxBytes)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type ConvertDiagramFileInput struct {
+	InputPath    string         `json:"inputPath" jsonschema:"Path to the diagram source file, or \"-\" to read the content field instead of a file."`
+	Content      string         `json:"content,omitempty" jsonschema:"Diagram source to convert. Required when inputPath is \"-\", ignored otherwise."`
+	OutputPath   string         `json:"outputPath" jsonschema:"Complete file path where the rendered diagram should be saved."`
+	Type         string         `json:"type,omitempty" jsonschema:"Diagram type override. If unspecified it is inferred from inputPath's extension (e.g. .puml, .mmd, .dot)."`
+	OutputFormat string         `json:"outputFormat,omitempty" jsonschema:"Output format override. If unspecified it is inferred from outputPath's extension (.jpg is treated as jpeg)."`
+	Scale        float64        `json:"scale,omitempty" jsonschema:"Scaling factor for SVG, PNG, and JPEG output, or the ?scale= query value for PDF (default 1.0)."`
+	DPI          float64        `json:"dpi,omitempty" jsonschema:"For PNG output, multiplies width/height by dpi/96 and writes a pHYs chunk recording the physical size. Unset leaves the image at the default 96 DPI."`
+	Resample     string         `json:"resample,omitempty" jsonschema:"Resampling algorithm for PNG/JPEG scaling: catmullrom (default, sharper) or bilinear (cheaper). Falls back to KROKI_RESAMPLE when unset."`
+	Options      map[string]any `json:"diagram_options,omitempty" jsonschema:"Per-diagram renderer options passed through to Kroki as diagram_options via a POST request."`
+}
+
+type ConvertDiagramFileOutput struct {
+	Message string `json:"message"`
+}
+
+// ConvertDiagramFile returns the convert_diagram_file tool handler bound to
+// krokiServer (see GenerateDiagramURL in main.go).
+func ConvertDiagramFile(krokiServer *KrokiServer) func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ConvertDiagramFileInput]) (*mcp.CallToolResultFor[ConvertDiagramFileOutput], error) {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ConvertDiagramFileInput]) (*mcp.CallToolResultFor[ConvertDiagramFileOutput], error) {
+		input := params.Arguments
+
+		content, err := readDiagramSource(input.InputPath, input.Content)
+		if err != nil {
+			return &mcp.CallToolResultFor[ConvertDiagramFileOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to read diagram source: %v", err)}},
+				IsError: true,
+			}, nil
+		}
+
+		diagramType := input.Type
+		if diagramType == "" {
+			inferred, ok := diagramTypeFromExtension(input.InputPath)
+			if !ok {
+				return &mcp.CallToolResultFor[ConvertDiagramFileOutput]{
+					Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Could not infer diagram type from %q. Set the type field explicitly.", input.InputPath)}},
+					IsError: true,
+				}, nil
+			}
+			diagramType = string(inferred)
+		}
+
+		outputFormat := input.OutputFormat
+		if outputFormat == "" {
+			if inferred, ok := imageFormatFromExtension(input.OutputPath); ok {
+				outputFormat = string(inferred)
+			} else {
+				outputFormat = "svg"
+			}
+		}
+
+		scale := input.Scale
+		if scale == 0 {
+			scale = 1.0
+		}
+
+		data, err := krokiServer.getDiagramData(ctx, diagramType, content, outputFormat, scale, input.DPI, input.Resample, input.Options)
+		if err != nil {
+			return &mcp.CallToolResultFor[ConvertDiagramFileOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to convert %s to %s: %v", input.InputPath, input.OutputPath, err)}},
+				IsError: true,
+			}, nil
+		}
+
+		dir := filepath.Dir(input.OutputPath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return &mcp.CallToolResultFor[ConvertDiagramFileOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to create directory %s: %v", dir, err)}},
+				IsError: true,
+			}, nil
+		}
+
+		if err := os.WriteFile(input.OutputPath, data, 0644); err != nil {
+			return &mcp.CallToolResultFor[ConvertDiagramFileOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to write file %s: %v", input.OutputPath, err)}},
+				IsError: true,
+			}, nil
+		}
+
+		return &mcp.CallToolResultFor[ConvertDiagramFileOutput]{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Converted %s (%s) to %s", input.InputPath, diagramType, input.OutputPath)}},
+			StructuredContent: ConvertDiagramFileOutput{
+				Message: fmt.Sprintf("Converted %s (%s) to %s", input.InputPath, diagramType, input.OutputPath),
+			},
+		}, nil
+	}
+}
+
+// readDiagramSource reads diagram content from inputPath, or returns
+// inlineContent directly when inputPath is "-" (stdin-style, mirroring
+// kroki-cli's `convert` command).
+func readDiagramSource(inputPath, inlineContent string) (string, error) {
+	if inputPath == "-" {
+		return inlineContent, nil
+	}
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", inputPath, err)
+	}
+	return string(data), nil
+}
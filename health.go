@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type KrokiHealthInput struct{}
+
+type KrokiHealthOutput struct {
+	Status string         `json:"status"`
+	Health map[string]any `json:"health"`
+}
+
+// KrokiHealth returns the kroki_health tool handler bound to krokiServer
+// (see GenerateDiagramURL in main.go). It GETs {baseURL}/health, which Kroki
+// reports its enabled backends and their versions on, so users can discover
+// which of the supported diagram types their configured server actually
+// renders before submitting a diagram.
+func KrokiHealth(krokiServer *KrokiServer) func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[KrokiHealthInput]) (*mcp.CallToolResultFor[KrokiHealthOutput], error) {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[KrokiHealthInput]) (*mcp.CallToolResultFor[KrokiHealthOutput], error) {
+		health, err := krokiServer.health(ctx)
+		if err != nil {
+			return &mcp.CallToolResultFor[KrokiHealthOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to check Kroki health: %v", err)}},
+				IsError: true,
+			}, nil
+		}
+
+		healthJSON, _ := json.MarshalIndent(health, "", "  ")
+		return &mcp.CallToolResultFor[KrokiHealthOutput]{
+			Content: []mcp.Content{&mcp.TextContent{Text: string(healthJSON)}},
+			StructuredContent: KrokiHealthOutput{
+				Status: "ok",
+				Health: health,
+			},
+		}, nil
+	}
+}
+
+// health fetches and parses {baseURL}/health.
+func (ks *KrokiServer) health(ctx context.Context) (map[string]any, error) {
+	resp, err := ks.doWithRetry(ctx, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.baseURL+"/health", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build Kroki request: %w", err)
+		}
+		resp, err := ks.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reach Kroki: %w", err)
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read health response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Kroki health check failed (status: %d)", resp.StatusCode)
+	}
+
+	var health map[string]any
+	if err := json.Unmarshal(data, &health); err != nil {
+		return nil, fmt.Errorf("failed to parse health response: %w", err)
+	}
+
+	return health, nil
+}
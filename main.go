@@ -5,64 +5,177 @@ import (
 	"compress/zlib"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 const (
 	defaultKrokiURL = "https://kroki.io"
-)
 
-var (
-	validDiagramTypes = []string{
-		"mermaid", "plantuml", "graphviz", "c4plantuml",
-		"excalidraw", "erd", "svgbob", "nomnoml", "wavedrom",
-		"blockdiag", "seqdiag", "actdiag", "nwdiag", "packetdiag",
-		"rackdiag", "umlet", "ditaa", "vega", "vegalite",
-		"bpmn", "bytefield", "d2", "dbml", "pikchr",
-		"structurizr", "symbolator", "tikz", "wireviz",
-	}
-	validOutputFormats = []string{"svg", "png", "pdf", "jpeg", "base64"}
+	// defaultMaxPostContentBytes caps how large a diagram source can be
+	// before we stop trying to POST it with diagram_options and silently
+	// fall back to the plain GET URL (which ignores options).
+	defaultMaxPostContentBytes = 1 << 20 // 1 MiB
+
+	defaultHTTPTimeout         = 30 * time.Second
+	defaultMaxIdleConnsPerHost = 10
+
+	defaultMaxRetries     = 2
+	defaultRetryBaseDelay = 200 * time.Millisecond
 )
 
 type KrokiServer struct {
-	baseURL string
+	baseURL            string
+	maxPostContentSize int
+	cache              Cache
+	httpClient         *http.Client
+	policy             *SourcePolicy
+	maxRetries         int
+	retryBaseDelay     time.Duration
 }
 
-func NewKrokiServer() *KrokiServer {
-	baseURL := os.Getenv("KROKI_SERVER_URL")
+// KrokiServerConfig holds the settings NewKrokiServer needs to build a
+// KrokiServer. Zero-value BaseURL, MaxPostContentSize, HTTPClient,
+// HTTPTimeout and RetryBaseDelay fall back to their defaults, so callers can
+// populate only the fields they care about. A zero MaxRetries disables
+// retries, and a nil Cache or Policy disables caching or the source policy.
+type KrokiServerConfig struct {
+	BaseURL            string
+	MaxPostContentSize int
+	Cache              Cache
+	HTTPClient         *http.Client
+	HTTPTimeout        time.Duration
+	Policy             *SourcePolicy
+	MaxRetries         int
+	RetryBaseDelay     time.Duration
+}
+
+func NewKrokiServer(cfg KrokiServerConfig) *KrokiServer {
+	baseURL := cfg.BaseURL
 	if baseURL == "" {
 		baseURL = defaultKrokiURL
 	}
 	baseURL = strings.TrimSuffix(baseURL, "/")
-	return &KrokiServer{baseURL: baseURL}
+
+	maxPostContentSize := cfg.MaxPostContentSize
+	if maxPostContentSize == 0 {
+		maxPostContentSize = defaultMaxPostContentBytes
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		timeout := cfg.HTTPTimeout
+		if timeout == 0 {
+			timeout = defaultHTTPTimeout
+		}
+		httpClient = &http.Client{
+			Timeout: timeout,
+			// Transport leaves DisableCompression false (its zero value), so
+			// Go transparently sends Accept-Encoding: gzip and decompresses
+			// matching responses for every request on this client.
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+			},
+		}
+	}
+
+	retryBaseDelay := cfg.RetryBaseDelay
+	if retryBaseDelay == 0 {
+		retryBaseDelay = defaultRetryBaseDelay
+	}
+
+	return &KrokiServer{
+		baseURL:            baseURL,
+		maxPostContentSize: maxPostContentSize,
+		cache:              cfg.Cache,
+		httpClient:         httpClient,
+		policy:             cfg.Policy,
+		maxRetries:         cfg.MaxRetries,
+		retryBaseDelay:     retryBaseDelay,
+	}
 }
 
-func (ks *KrokiServer) validateDiagramType(diagramType string) error {
-	for _, valid := range validDiagramTypes {
-		if diagramType == valid {
-			return nil
+// krokiServerConfigFromEnv builds the default KrokiServerConfig from
+// environment toggles: KROKI_SERVER_URL, KROKI_MAX_POST_BYTES,
+// KROKI_HTTP_TIMEOUT, KROKI_MAX_RETRIES, and KROKI_RETRY_BASE_MS here, the
+// cache settings handled by newCacheFromEnv, and the source policy settings
+// handled by newSourcePolicyFromEnv.
+func krokiServerConfigFromEnv() KrokiServerConfig {
+	maxPostContentSize := defaultMaxPostContentBytes
+	if raw := os.Getenv("KROKI_MAX_POST_BYTES"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			maxPostContentSize = parsed
 		}
 	}
-	return fmt.Errorf("invalid diagram type. Must be one of: %s", strings.Join(validDiagramTypes, ", "))
+
+	httpTimeout := defaultHTTPTimeout
+	if raw := os.Getenv("KROKI_HTTP_TIMEOUT"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			httpTimeout = parsed
+		}
+	}
+
+	maxRetries := defaultMaxRetries
+	if raw := os.Getenv("KROKI_MAX_RETRIES"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+			maxRetries = parsed
+		}
+	}
+
+	retryBaseDelay := defaultRetryBaseDelay
+	if raw := os.Getenv("KROKI_RETRY_BASE_MS"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			retryBaseDelay = time.Duration(parsed) * time.Millisecond
+		}
+	}
+
+	cache, err := newCacheFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[KrokiServer] Disk cache unavailable, continuing without it: %v\n", err)
+		cache = nil
+	}
+
+	policy, err := newSourcePolicyFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[KrokiServer] Source policy unavailable, continuing without it: %v\n", err)
+		policy = nil
+	}
+
+	return KrokiServerConfig{
+		BaseURL:            os.Getenv("KROKI_SERVER_URL"),
+		MaxPostContentSize: maxPostContentSize,
+		Cache:              cache,
+		HTTPTimeout:        httpTimeout,
+		Policy:             policy,
+		MaxRetries:         maxRetries,
+		RetryBaseDelay:     retryBaseDelay,
+	}
+}
+
+func (ks *KrokiServer) validateDiagramType(diagramType string) error {
+	if supportedDiagramTypes[DiagramType(diagramType)] {
+		return nil
+	}
+	return fmt.Errorf("invalid diagram type. Must be one of: %s", strings.Join(diagramTypeNames(), ", "))
 }
 
 func (ks *KrokiServer) validateOutputFormat(format string) error {
-	for _, valid := range validOutputFormats {
-		if format == valid {
-			return nil
-		}
+	if supportedImageFormats[ImageFormat(format)] {
+		return nil
 	}
-	return fmt.Errorf("invalid output format. Must be one of: %s", strings.Join(validOutputFormats, ", "))
+	return fmt.Errorf("invalid output format. Must be one of: %s", strings.Join(imageFormatNames(), ", "))
 }
 
 func (ks *KrokiServer) encodeContent(content string) (string, error) {
@@ -81,7 +194,99 @@ func (ks *KrokiServer) encodeContent(content string) (string, error) {
 	return encoded, nil
 }
 
-func (ks *KrokiServer) getDiagramData(diagramType, content, outputFormat string, scale float64) ([]byte, error) {
+// pdfScaleQuery renders a ?scale= query string for Kroki's PDF backends,
+// which (unlike PNG/JPEG) apply scale during rendering rather than something
+// we can resample after the fact. PDF page-size metadata isn't set client
+// side: Kroki's PDF output is already a complete, valid PDF and rewriting
+// its page-size metadata would mean pulling in a PDF-editing dependency for
+// a cosmetic field, so scale is the only lever exposed for PDF output.
+func pdfScaleQuery(outputFormat string, scale float64) string {
+	if outputFormat != "pdf" || scale == 1.0 {
+		return ""
+	}
+	return "?scale=" + strconv.FormatFloat(scale, 'f', -1, 64)
+}
+
+func (ks *KrokiServer) getDiagramDataGET(ctx context.Context, diagramType, outputFormat, content string, scale float64) (*http.Response, error) {
+	encodedContent, err := ks.encodeContent(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode content: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/%s/%s/%s", ks.baseURL, diagramType, outputFormat, encodedContent) + pdfScaleQuery(outputFormat, scale)
+
+	return ks.doWithRetry(ctx, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build Kroki request: %w", err)
+		}
+		resp, err := ks.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch diagram from Kroki: %w", err)
+		}
+		return resp, nil
+	})
+}
+
+func (ks *KrokiServer) postDiagramData(ctx context.Context, diagramType, outputFormat, content string, options map[string]any, scale float64) (*http.Response, error) {
+	body, err := json.Marshal(map[string]any{
+		"diagram_source":  content,
+		"diagram_options": options,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode diagram options: %w", err)
+	}
+
+	reqURL := fmt.Sprintf("%s/%s/%s", ks.baseURL, diagramType, outputFormat) + pdfScaleQuery(outputFormat, scale)
+
+	return ks.doWithRetry(ctx, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to build Kroki request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := ks.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch diagram from Kroki: %w", err)
+		}
+		return resp, nil
+	})
+}
+
+// doWithRetry calls do, retrying on 5xx responses and network errors with
+// exponential backoff (ks.retryBaseDelay, doubling each attempt) up to
+// ks.maxRetries times, honoring ctx cancellation between attempts. Response
+// bodies from retried (non-final) attempts are drained and closed here.
+func (ks *KrokiServer) doWithRetry(ctx context.Context, do func() (*http.Response, error)) (*http.Response, error) {
+	delay := ks.retryBaseDelay
+
+	for attempt := 0; ; attempt++ {
+		resp, err := do()
+		retryable := err != nil || resp.StatusCode >= 500
+		if !retryable || attempt == ks.maxRetries {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// getDiagramData renders a diagram via Kroki. scale applies to SVG (rewriting
+// the root width/height, only when scale > 1.0), PNG/JPEG (resampled client-side via scale, and for
+// PNG additionally by dpi/96), and PDF (passed through as a ?scale= query
+// parameter, which Kroki honors for several backends). dpi also writes a
+// pHYs chunk recording the physical size; resample only applies to PNG/JPEG.
+func (ks *KrokiServer) getDiagramData(ctx context.Context, diagramType, content, outputFormat string, scale, dpi float64, resample string, options map[string]any) ([]byte, error) {
 	if err := ks.validateDiagramType(diagramType); err != nil {
 		return nil, err
 	}
@@ -89,16 +294,30 @@ func (ks *KrokiServer) getDiagramData(diagramType, content, outputFormat string,
 		return nil, err
 	}
 
-	encodedContent, err := ks.encodeContent(content)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode content: %w", err)
+	if ks.policy != nil {
+		checked, err := ks.policy.Check(diagramType, content)
+		if err != nil {
+			return nil, err
+		}
+		content = checked
 	}
 
-	url := fmt.Sprintf("%s/%s/%s/%s", ks.baseURL, diagramType, outputFormat, encodedContent)
+	key := cacheKey(diagramType, outputFormat, scale, dpi, resample, content, options)
+	if ks.cache != nil {
+		if cached, ok := ks.cache.Get(key, outputFormat); ok {
+			return cached, nil
+		}
+	}
 
-	resp, err := http.Get(url)
+	var resp *http.Response
+	var err error
+	if len(options) > 0 && len(content) <= ks.maxPostContentSize {
+		resp, err = ks.postDiagramData(ctx, diagramType, outputFormat, content, options, scale)
+	} else {
+		resp, err = ks.getDiagramDataGET(ctx, diagramType, outputFormat, content, scale)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch diagram from Kroki: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -168,6 +387,37 @@ func (ks *KrokiServer) getDiagramData(diagramType, content, outputFormat string,
 		}
 	}
 
+	if (outputFormat == "png" || outputFormat == "jpeg") && len(data) > 0 {
+		rasterScale := scale
+		if outputFormat == "png" && dpi > 0 {
+			// dpi multiplies pixel dimensions by dpi/96 on top of any
+			// explicit scale, so the pHYs chunk applyPNGDPI writes below
+			// describes the image's actual physical size rather than
+			// shrinking it at the original pixel dimensions.
+			rasterScale *= dpi / defaultPNGDPI
+		}
+
+		scaled, err := scaleRaster(data, outputFormat, rasterScale, resample)
+		if err != nil {
+			return nil, err
+		}
+		data = scaled
+
+		if outputFormat == "png" && dpi > 0 {
+			withDPI, err := applyPNGDPI(data, dpi)
+			if err != nil {
+				return nil, err
+			}
+			data = withDPI
+		}
+	}
+
+	if ks.cache != nil {
+		if err := ks.cache.Put(key, outputFormat, data); err != nil {
+			fmt.Fprintf(os.Stderr, "[KrokiServer] Failed to write cache entry: %v\n", err)
+		}
+	}
+
 	return data, nil
 }
 
@@ -213,7 +463,7 @@ func (ks *KrokiServer) scaleSVG(svgContent string, scale float64) string {
 	})
 }
 
-func (ks *KrokiServer) generateDiagramURL(diagramType, content, outputFormat string) (string, error) {
+func (ks *KrokiServer) generateDiagramURL(ctx context.Context, diagramType, content, outputFormat string, options map[string]any) (string, error) {
 	if err := ks.validateDiagramType(diagramType); err != nil {
 		return "", err
 	}
@@ -226,7 +476,7 @@ func (ks *KrokiServer) generateDiagramURL(diagramType, content, outputFormat str
 		checkFormat = "svg"
 	}
 
-	if _, err := ks.getDiagramData(diagramType, content, checkFormat, 1.0); err != nil {
+	if _, err := ks.getDiagramData(ctx, diagramType, content, checkFormat, 1.0, 0, "", options); err != nil {
 		return "", err
 	}
 
@@ -235,13 +485,32 @@ func (ks *KrokiServer) generateDiagramURL(diagramType, content, outputFormat str
 		return "", fmt.Errorf("failed to encode content: %w", err)
 	}
 
-	return fmt.Sprintf("%s/%s/%s/%s", ks.baseURL, diagramType, outputFormat, encodedContent), nil
+	diagramURL := fmt.Sprintf("%s/%s/%s/%s", ks.baseURL, diagramType, outputFormat, encodedContent)
+	if len(options) > 0 {
+		diagramURL += "?" + diagramOptionsQuery(options)
+	}
+
+	return diagramURL, nil
+}
+
+// diagramOptionsQuery renders diagram_options as a flat diagram_options[key]=value
+// query string. Kroki's GET endpoint cannot embed options in the deflate+base64
+// path segment, so this is a best-effort alternative for servers/proxies that
+// read diagram_options from the query string; it has no effect against a stock
+// Kroki instance, which only honors diagram_options on the POST endpoint.
+func diagramOptionsQuery(options map[string]any) string {
+	values := url.Values{}
+	for key, value := range options {
+		values.Set(fmt.Sprintf("diagram_options[%s]", key), fmt.Sprint(value))
+	}
+	return values.Encode()
 }
 
 type GenerateDiagramURLInput struct {
-	Type         string `json:"type" jsonschema:"Diagram type (e.g. mermaid plantuml graphviz c4plantuml). See Kroki.io documentation for all supported formats."`
-	Content      string `json:"content" jsonschema:"The diagram content in the specified format."`
-	OutputFormat string `json:"outputFormat,omitempty" jsonschema:"Output format: svg (default) png pdf jpeg or base64."`
+	Type         string         `json:"type" jsonschema:"Diagram type (e.g. mermaid plantuml graphviz c4plantuml). See Kroki.io documentation for all supported formats."`
+	Content      string         `json:"content" jsonschema:"The diagram content in the specified format."`
+	OutputFormat string         `json:"outputFormat,omitempty" jsonschema:"Output format: svg (default) png pdf jpeg or base64."`
+	Options      map[string]any `json:"diagram_options,omitempty" jsonschema:"Per-diagram renderer options (e.g. theme layout) passed through to Kroki as diagram_options. Since a GET URL cannot embed these, they are appended as a diagram_options[key]=value query string instead of being baked into the path."`
 }
 
 type GenerateDiagramURLOutput struct {
@@ -249,53 +518,78 @@ type GenerateDiagramURLOutput struct {
 	URL     string `json:"url"`
 }
 
-func GenerateDiagramURL(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GenerateDiagramURLInput]) (*mcp.CallToolResultFor[GenerateDiagramURLOutput], error) {
-	krokiServer := NewKrokiServer()
+// GenerateDiagramURL returns the generate_diagram_url tool handler bound to
+// krokiServer, which is constructed once in main and shared across every
+// tool so they reuse its http.Client's connection pool instead of paying a
+// fresh dial per call.
+func GenerateDiagramURL(krokiServer *KrokiServer) func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GenerateDiagramURLInput]) (*mcp.CallToolResultFor[GenerateDiagramURLOutput], error) {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GenerateDiagramURLInput]) (*mcp.CallToolResultFor[GenerateDiagramURLOutput], error) {
+		input := params.Arguments
+		outputFormat := input.OutputFormat
+		if outputFormat == "" {
+			outputFormat = "svg"
+		}
 
-	input := params.Arguments
-	outputFormat := input.OutputFormat
-	if outputFormat == "" {
-		outputFormat = "svg"
-	}
+		url, err := krokiServer.generateDiagramURL(ctx, input.Type, input.Content, outputFormat, input.Options)
+		if err != nil {
+			return &mcp.CallToolResultFor[GenerateDiagramURLOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to generate diagram URL: %v", err)}},
+				IsError: true,
+			}, nil
+		}
 
-	url, err := krokiServer.generateDiagramURL(input.Type, input.Content, outputFormat)
-	if err != nil {
 		return &mcp.CallToolResultFor[GenerateDiagramURLOutput]{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to generate diagram URL: %v", err)}},
-			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Diagram URL generated and validated successfully. No errors found.\nURL: %s", url)}},
+			StructuredContent: GenerateDiagramURLOutput{
+				Message: "Diagram URL generated and validated successfully. No errors found.",
+				URL:     url,
+			},
 		}, nil
 	}
-
-	return &mcp.CallToolResultFor[GenerateDiagramURLOutput]{
-		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Diagram URL generated and validated successfully. No errors found.\nURL: %s", url)}},
-		StructuredContent: GenerateDiagramURLOutput{
-			Message: "Diagram URL generated and validated successfully. No errors found.",
-			URL:     url,
-		},
-	}, nil
 }
 
 type DownloadDiagramInput struct {
-	Type         string  `json:"type" jsonschema:"Diagram type (e.g. mermaid plantuml graphviz). Supports the same diagram types as Kroki.io."`
-	Content      string  `json:"content" jsonschema:"The diagram content in the specified format."`
-	OutputPath   string  `json:"outputPath" jsonschema:"Complete file path where the diagram should be saved."`
-	OutputFormat string  `json:"outputFormat,omitempty" jsonschema:"Output format (svg png pdf jpeg). If unspecified derived from file extension."`
-	Scale        float64 `json:"scale,omitempty" jsonschema:"Scaling factor for SVG output (default 1.0)."`
+	Type         string         `json:"type" jsonschema:"Diagram type (e.g. mermaid plantuml graphviz). Supports the same diagram types as Kroki.io."`
+	Content      string         `json:"content" jsonschema:"The diagram content in the specified format."`
+	OutputPath   string         `json:"outputPath" jsonschema:"Complete file path where the diagram should be saved."`
+	OutputFormat string         `json:"outputFormat,omitempty" jsonschema:"Output format (svg png pdf jpeg). If unspecified derived from file extension."`
+	Scale        float64        `json:"scale,omitempty" jsonschema:"Scaling factor for SVG, PNG, and JPEG output, or the ?scale= query value for PDF (default 1.0)."`
+	DPI          float64        `json:"dpi,omitempty" jsonschema:"For PNG output, multiplies width/height by dpi/96 and writes a pHYs chunk recording the physical size (e.g. for LaTeX or Word). Unset leaves the image at the default 96 DPI."`
+	Resample     string         `json:"resample,omitempty" jsonschema:"Resampling algorithm for PNG/JPEG scaling: catmullrom (default, sharper) or bilinear (cheaper). Falls back to KROKI_RESAMPLE when unset."`
+	Options      map[string]any `json:"diagram_options,omitempty" jsonschema:"Per-diagram renderer options (e.g. theme layout background) passed through to Kroki as diagram_options via a POST request."`
 }
 
 type DownloadDiagramOutput struct {
 	Message string `json:"message"`
 }
 
-func DownloadDiagram(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[DownloadDiagramInput]) (*mcp.CallToolResultFor[DownloadDiagramOutput], error) {
-	krokiServer := NewKrokiServer()
+// DownloadDiagram returns the download_diagram tool handler bound to
+// krokiServer (see GenerateDiagramURL).
+func DownloadDiagram(krokiServer *KrokiServer) func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[DownloadDiagramInput]) (*mcp.CallToolResultFor[DownloadDiagramOutput], error) {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[DownloadDiagramInput]) (*mcp.CallToolResultFor[DownloadDiagramOutput], error) {
+		if err := krokiServer.downloadDiagram(ctx, params.Arguments); err != nil {
+			return &mcp.CallToolResultFor[DownloadDiagramOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+				IsError: true,
+			}, nil
+		}
 
-	input := params.Arguments
+		message := fmt.Sprintf("Diagram saved to %s", params.Arguments.OutputPath)
+		return &mcp.CallToolResultFor[DownloadDiagramOutput]{
+			Content:           []mcp.Content{&mcp.TextContent{Text: message}},
+			StructuredContent: DownloadDiagramOutput{Message: message},
+		}, nil
+	}
+}
+
+// downloadDiagram renders input and writes it to input.OutputPath. It is
+// shared by the download_diagram and render_diagrams_batch tools so both
+// produce identical files and error messages.
+func (ks *KrokiServer) downloadDiagram(ctx context.Context, input DownloadDiagramInput) error {
 	outputFormat := input.OutputFormat
 	if outputFormat == "" {
-		ext := filepath.Ext(input.OutputPath)
-		if len(ext) > 1 {
-			outputFormat = ext[1:]
+		if inferred, ok := imageFormatFromExtension(input.OutputPath); ok {
+			outputFormat = string(inferred)
 		} else {
 			outputFormat = "svg"
 		}
@@ -306,35 +600,56 @@ func DownloadDiagram(ctx context.Context, ss *mcp.ServerSession, params *mcp.Cal
 		scale = 1.0
 	}
 
-	data, err := krokiServer.getDiagramData(input.Type, input.Content, outputFormat, scale)
+	data, err := ks.getDiagramData(ctx, input.Type, input.Content, outputFormat, scale, input.DPI, input.Resample, input.Options)
 	if err != nil {
-		return &mcp.CallToolResultFor[DownloadDiagramOutput]{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to download diagram to %s: %v", input.OutputPath, err)}},
-			IsError: true,
-		}, nil
+		return fmt.Errorf("failed to download diagram to %s: %w", input.OutputPath, err)
 	}
 
 	dir := filepath.Dir(input.OutputPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return &mcp.CallToolResultFor[DownloadDiagramOutput]{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to create directory %s: %v", dir, err)}},
-			IsError: true,
-		}, nil
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
 
 	if err := os.WriteFile(input.OutputPath, data, 0644); err != nil {
-		return &mcp.CallToolResultFor[DownloadDiagramOutput]{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to write file %s: %v", input.OutputPath, err)}},
-			IsError: true,
-		}, nil
+		return fmt.Errorf("failed to write file %s: %w", input.OutputPath, err)
 	}
 
-	return &mcp.CallToolResultFor[DownloadDiagramOutput]{
-		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Diagram saved to %s", input.OutputPath)}},
-		StructuredContent: DownloadDiagramOutput{
-			Message: fmt.Sprintf("Diagram saved to %s", input.OutputPath),
-		},
-	}, nil
+	return nil
+}
+
+type ClearDiagramCacheInput struct{}
+
+type ClearDiagramCacheOutput struct {
+	Message string `json:"message"`
+}
+
+// ClearDiagramCache returns the clear_diagram_cache tool handler bound to
+// krokiServer (see GenerateDiagramURL).
+func ClearDiagramCache(krokiServer *KrokiServer) func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ClearDiagramCacheInput]) (*mcp.CallToolResultFor[ClearDiagramCacheOutput], error) {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ClearDiagramCacheInput]) (*mcp.CallToolResultFor[ClearDiagramCacheOutput], error) {
+		if krokiServer.cache == nil {
+			return &mcp.CallToolResultFor[ClearDiagramCacheOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: "Diagram cache is disabled; nothing to clear."}},
+				StructuredContent: ClearDiagramCacheOutput{
+					Message: "Diagram cache is disabled; nothing to clear.",
+				},
+			}, nil
+		}
+
+		if err := krokiServer.cache.Clear(); err != nil {
+			return &mcp.CallToolResultFor[ClearDiagramCacheOutput]{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to clear diagram cache: %v", err)}},
+				IsError: true,
+			}, nil
+		}
+
+		return &mcp.CallToolResultFor[ClearDiagramCacheOutput]{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Diagram cache cleared."}},
+			StructuredContent: ClearDiagramCacheOutput{
+				Message: "Diagram cache cleared.",
+			},
+		}, nil
+	}
 }
 
 func main() {
@@ -346,15 +661,40 @@ func main() {
 		nil,
 	)
 
+	// A single KrokiServer is built once and shared across every tool, so
+	// its http.Client's connection pool and retry machinery are amortized
+	// across calls instead of every tool invocation paying a fresh dial.
+	krokiServer := NewKrokiServer(krokiServerConfigFromEnv())
+
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "generate_diagram_url",
-		Description: "Generate a URL for a diagram using Kroki.io. This tool takes Mermaid diagram code or other supported diagram formats and returns a URL to the rendered diagram. The URL can be used to display the diagram in web browsers or embedded in documents. Supported diagram types: mermaid, plantuml, graphviz, c4plantuml, excalidraw, erd, svgbob, nomnoml, wavedrom, blockdiag, seqdiag, actdiag, nwdiag, packetdiag, rackdiag, umlet, ditaa, vega, vegalite, bpmn, bytefield, d2, dbml, pikchr, structurizr, symbolator, tikz, wireviz. Supported output formats: svg, png, pdf, jpeg, base64.",
-	}, GenerateDiagramURL)
+		Description: "Generate a URL for a diagram using Kroki.io. This tool takes Mermaid diagram code or other supported diagram formats and returns a URL to the rendered diagram. The URL can be used to display the diagram in web browsers or embedded in documents. Supported diagram types: " + strings.Join(diagramTypeNames(), ", ") + ". Supported output formats: " + strings.Join(imageFormatNames(), ", ") + ".",
+	}, GenerateDiagramURL(krokiServer))
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "download_diagram",
-		Description: "Download a diagram image to a local file. This tool converts diagram code (such as Mermaid) into an image file and saves it to the specified location. Useful for generating diagrams for presentations, documentation, or other offline use. Includes an option to scale SVG output. Supported diagram types: mermaid, plantuml, graphviz, c4plantuml, excalidraw, erd, svgbob, nomnoml, wavedrom, blockdiag, seqdiag, actdiag, nwdiag, packetdiag, rackdiag, umlet, ditaa, vega, vegalite, bpmn, bytefield, d2, dbml, pikchr, structurizr, symbolator, tikz, wireviz. Supported output formats: svg, png, pdf, jpeg, base64.",
-	}, DownloadDiagram)
+		Description: "Download a diagram image to a local file. This tool converts diagram code (such as Mermaid) into an image file and saves it to the specified location. Useful for generating diagrams for presentations, documentation, or other offline use. Includes options to scale SVG, PNG, JPEG, or PDF output and to set a PNG's physical DPI. Supported diagram types: " + strings.Join(diagramTypeNames(), ", ") + ". Supported output formats: " + strings.Join(imageFormatNames(), ", ") + ".",
+	}, DownloadDiagram(krokiServer))
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "convert_diagram_file",
+		Description: "Convert a diagram source file to a rendered image file, inferring the diagram type from the input file's extension (e.g. .puml, .mmd, .dot) and the output format from the output file's extension. Pass inputPath \"-\" to supply the diagram source inline via the content field instead of a file. Supported diagram types: " + strings.Join(diagramTypeNames(), ", ") + ". Supported output formats: " + strings.Join(imageFormatNames(), ", ") + ".",
+	}, ConvertDiagramFile(krokiServer))
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "render_diagrams_batch",
+		Description: "Render multiple diagrams concurrently and write each to its outputPath, accepting the same per-item fields as download_diagram. Useful for documentation pipelines that regenerate many diagrams at once. Concurrency is bounded by KROKI_MAX_CONCURRENCY (default GOMAXPROCS); each item's success or failure is reported individually rather than aborting the whole batch on the first error.",
+	}, RenderDiagramsBatch(krokiServer))
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "clear_diagram_cache",
+		Description: "Clear the on-disk diagram render cache (enabled by default, see KROKI_CACHE_ENABLED). Use this after changing the Kroki server or diagram options if you want to force re-rendering instead of reusing cached output.",
+	}, ClearDiagramCache(krokiServer))
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "kroki_health",
+		Description: "Check the configured Kroki server's /health endpoint, which reports its enabled backends and their versions. Use this to discover which diagram types a self-hosted or proxied Kroki instance actually supports before submitting a render.",
+	}, KrokiHealth(krokiServer))
 
 	if err := server.Run(context.Background(), mcp.NewStdioTransport()); err != nil {
 		log.Fatal(err)
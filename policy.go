@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMaxSourceBytes = 1 << 20 // 1 MiB, mirrors defaultMaxPostContentBytes
+
+	maxSourceBytesEnvVar   = "KROKI_MAX_SOURCE_BYTES"
+	includeAllowlistEnvVar = "KROKI_INCLUDE_ALLOWLIST"
+	includeModeEnvVar      = "KROKI_INCLUDE_MODE"   // "reject" (default) or "strip"
+	policyEnabledEnvVar    = "KROKI_POLICY_ENABLED" // "false" disables the source policy entirely
+)
+
+// PolicyViolation is returned by getDiagramData when a diagram source fails
+// the configured SourcePolicy, so the MCP tool layer can surface an
+// actionable message instead of a generic Kroki error.
+type PolicyViolation struct {
+	Reason string
+}
+
+func (e *PolicyViolation) Error() string {
+	return fmt.Sprintf("diagram rejected by policy: %s", e.Reason)
+}
+
+// plantUMLDiagramTypes are the diagram types whose source can contain
+// PlantUML preprocessor directives. The denylist and include allowlist below
+// only make sense for these: !import/!include/!includeurl aren't directives
+// in any other Kroki diagram language, so applying them generally would just
+// reject unrelated content (e.g. Mermaid's "!important" CSS, or the <?xml
+// prolog every BPMN/Structurizr export starts with).
+var plantUMLDiagramTypes = map[DiagramType]bool{
+	"plantuml":   true,
+	"c4plantuml": true,
+}
+
+// includeDirectiveRegex matches PlantUML's !include and !includeurl
+// directives, capturing the referenced path or URL.
+var includeDirectiveRegex = regexp.MustCompile(`(?m)^[ \t]*!include(?:url)?[ \t]+(\S+)`)
+
+// denylistedDirectives are PlantUML preprocessor directives that can be used
+// to pull in arbitrary local files or trigger SSRF via Kroki's
+// include-fetching, and are rejected outright regardless of the include
+// allowlist. !pragma (e.g. "!pragma teoz true") is deliberately not on this
+// list: it only toggles renderer behavior and never fetches anything, so
+// there's no SSRF/file-read risk to guard against. Each regex is anchored to
+// the directive's actual syntax (start of line, then the bang-word) so it
+// can't match unrelated substrings, such as "!important" in a Mermaid style
+// directive matching "!import".
+var denylistedDirectives = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"!import", regexp.MustCompile(`(?m)^[ \t]*!import\b`)},
+}
+
+// SourcePolicy bounds what diagram sources getDiagramData will submit to
+// Kroki: a size cap applied to every diagram type, and (for PlantUML and
+// C4-PlantUML only) a denylist of directives that can be used to pull in
+// arbitrary files or trigger SSRF plus an allowlist of URLs/domains
+// permitted in !include/!includeurl directives.
+type SourcePolicy struct {
+	MaxSourceBytes      int
+	IncludeAllowlist    []*regexp.Regexp
+	StripUnsafeIncludes bool
+}
+
+// Check validates content against the policy for the given diagramType,
+// returning the (possibly rewritten) content and a *PolicyViolation when it
+// fails outright. The PlantUML-specific checks (denylisted directives,
+// include allowlist) are skipped entirely for other diagram types. When
+// StripUnsafeIncludes is set, disallowed !include/!includeurl directives are
+// rewritten to a comment instead of causing a rejection.
+func (p *SourcePolicy) Check(diagramType, content string) (string, error) {
+	if p.MaxSourceBytes > 0 && len(content) > p.MaxSourceBytes {
+		return content, &PolicyViolation{Reason: fmt.Sprintf("diagram source is %d bytes, exceeds the %d byte limit", len(content), p.MaxSourceBytes)}
+	}
+
+	if !plantUMLDiagramTypes[DiagramType(diagramType)] {
+		return content, nil
+	}
+
+	for _, directive := range denylistedDirectives {
+		if directive.re.MatchString(content) {
+			return content, &PolicyViolation{Reason: fmt.Sprintf("diagram source contains disallowed directive %q", directive.name)}
+		}
+	}
+
+	matches := includeDirectiveRegex.FindAllStringSubmatchIndex(content, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		match := matches[i]
+		target := content[match[2]:match[3]]
+		if p.includeAllowed(target) {
+			continue
+		}
+		if p.StripUnsafeIncludes {
+			content = content[:match[0]] + "' include removed by policy" + content[match[1]:]
+			continue
+		}
+		return content, &PolicyViolation{Reason: fmt.Sprintf("include target %q is not in the configured allowlist", target)}
+	}
+
+	return content, nil
+}
+
+// includeAllowed reports whether target may be fetched by an !include or
+// !includeurl directive. With no allowlist configured (the default for every
+// deployment), includes are allowed rather than rejected outright, matching
+// this policy's denylist-first posture and preserving stock idioms like
+// C4-PlantUML's "!includeurl https://raw.githubusercontent.com/...". Set
+// KROKI_INCLUDE_ALLOWLIST to restrict includes to specific sources instead.
+func (p *SourcePolicy) includeAllowed(target string) bool {
+	if len(p.IncludeAllowlist) == 0 {
+		return true
+	}
+	for _, re := range p.IncludeAllowlist {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSourcePolicyFromEnv builds the default SourcePolicy from environment
+// toggles, or returns nil when KROKI_POLICY_ENABLED=false. KROKI_INCLUDE_ALLOWLIST
+// is a comma-separated list of regexes matched against !include/!includeurl
+// targets in PlantUML/C4-PlantUML sources; leaving it unset allows any
+// include (see includeAllowed), so it is opt-in hardening rather than an
+// always-on restriction.
+func newSourcePolicyFromEnv() (*SourcePolicy, error) {
+	if raw := os.Getenv(policyEnabledEnvVar); raw != "" {
+		if enabled, err := strconv.ParseBool(raw); err == nil && !enabled {
+			return nil, nil
+		}
+	}
+
+	maxSourceBytes := defaultMaxSourceBytes
+	if raw := os.Getenv(maxSourceBytesEnvVar); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			maxSourceBytes = parsed
+		}
+	}
+
+	var allowlist []*regexp.Regexp
+	if raw := os.Getenv(includeAllowlistEnvVar); raw != "" {
+		for _, pattern := range strings.Split(raw, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q in %s: %w", pattern, includeAllowlistEnvVar, err)
+			}
+			allowlist = append(allowlist, re)
+		}
+	}
+
+	return &SourcePolicy{
+		MaxSourceBytes:      maxSourceBytes,
+		IncludeAllowlist:    allowlist,
+		StripUnsafeIncludes: strings.EqualFold(os.Getenv(includeModeEnvVar), "strip"),
+	}, nil
+}
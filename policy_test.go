@@ -0,0 +1,92 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSourcePolicyCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      *SourcePolicy
+		diagramType string
+		content     string
+		wantErr     bool
+	}{
+		{
+			name:        "oversized source is rejected regardless of type",
+			policy:      &SourcePolicy{MaxSourceBytes: 4},
+			diagramType: "mermaid",
+			content:     "graph TD",
+			wantErr:     true,
+		},
+		{
+			name:        "mermaid !important CSS is not mistaken for !import",
+			policy:      &SourcePolicy{MaxSourceBytes: defaultMaxSourceBytes},
+			diagramType: "mermaid",
+			content:     "style A fill:#f00 !important",
+			wantErr:     false,
+		},
+		{
+			name:        "bpmn xml prolog is untouched by PlantUML checks",
+			policy:      &SourcePolicy{MaxSourceBytes: defaultMaxSourceBytes},
+			diagramType: "bpmn",
+			content:     "<?xml version=\"1.0\" encoding=\"UTF-8\"?><definitions/>",
+			wantErr:     false,
+		},
+		{
+			name:        "plantuml !pragma is allowed",
+			policy:      &SourcePolicy{MaxSourceBytes: defaultMaxSourceBytes},
+			diagramType: "plantuml",
+			content:     "@startuml\n!pragma teoz true\nAlice -> Bob\n@enduml",
+			wantErr:     false,
+		},
+		{
+			name:        "plantuml !import is rejected",
+			policy:      &SourcePolicy{MaxSourceBytes: defaultMaxSourceBytes},
+			diagramType: "plantuml",
+			content:     "@startuml\n!import local.puml\n@enduml",
+			wantErr:     true,
+		},
+		{
+			name:        "c4plantuml !includeurl is allowed with no allowlist configured",
+			policy:      &SourcePolicy{MaxSourceBytes: defaultMaxSourceBytes},
+			diagramType: "c4plantuml",
+			content:     "!includeurl https://raw.githubusercontent.com/plantuml-stdlib/C4-PlantUML/master/C4_Context.puml",
+			wantErr:     false,
+		},
+		{
+			name:        "include rejected when it doesn't match a configured allowlist",
+			policy:      &SourcePolicy{MaxSourceBytes: defaultMaxSourceBytes, IncludeAllowlist: []*regexp.Regexp{regexp.MustCompile(`^https://raw\.githubusercontent\.com/`)}},
+			diagramType: "c4plantuml",
+			content:     "!includeurl https://evil.example.com/payload.puml",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.policy.Check(tt.diagramType, tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSourcePolicyCheckStripsUnsafeIncludes(t *testing.T) {
+	policy := &SourcePolicy{
+		MaxSourceBytes:      defaultMaxSourceBytes,
+		IncludeAllowlist:    []*regexp.Regexp{regexp.MustCompile(`^https://raw\.githubusercontent\.com/`)},
+		StripUnsafeIncludes: true,
+	}
+
+	content, err := policy.Check("plantuml", "!includeurl https://evil.example.com/payload.puml")
+	if err != nil {
+		t.Fatalf("Check() returned error %v, want nil when StripUnsafeIncludes is set", err)
+	}
+	if strings.Contains(content, "evil.example.com") {
+		t.Fatalf("Check() left the disallowed include target in place: %q", content)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+
+	ximagedraw "golang.org/x/image/draw"
+)
+
+const (
+	// defaultPNGDPI is the DPI PNG is assumed to already be at absent a pHYs
+	// chunk, so a dpi input equal to it is a no-op rather than a rewrite.
+	defaultPNGDPI = 96.0
+
+	resampleEnvVar = "KROKI_RESAMPLE"
+)
+
+// resampleInterpolator picks the x/image/draw interpolator used to resize
+// PNG/JPEG output. resample overrides KROKI_RESAMPLE when non-empty;
+// "bilinear" selects the cheaper ApproxBiLinear, anything else (including
+// unset) uses CatmullRom, which holds up better on diagram line art.
+func resampleInterpolator(resample string) ximagedraw.Interpolator {
+	if resample == "" {
+		resample = os.Getenv(resampleEnvVar)
+	}
+	if strings.EqualFold(resample, "bilinear") {
+		return ximagedraw.ApproxBiLinear
+	}
+	return ximagedraw.CatmullRom
+}
+
+// scaleRaster resizes PNG or JPEG image bytes by scale, re-encoding in the
+// same format. It is a no-op for scale == 1.0 or any other output format
+// (SVG scaling is handled separately by scaleSVG).
+func scaleRaster(data []byte, outputFormat string, scale float64, resample string) ([]byte, error) {
+	if scale == 1.0 {
+		return data, nil
+	}
+
+	var (
+		img image.Image
+		err error
+	)
+	switch outputFormat {
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s for scaling: %w", outputFormat, err)
+	}
+
+	bounds := img.Bounds()
+	dstRect := image.Rect(0, 0, int(float64(bounds.Dx())*scale), int(float64(bounds.Dy())*scale))
+	dst := image.NewRGBA(dstRect)
+	resampleInterpolator(resample).Scale(dst, dstRect, img, bounds, ximagedraw.Over, nil)
+
+	var buf bytes.Buffer
+	switch outputFormat {
+	case "png":
+		err = png.Encode(&buf, dst)
+	case "jpeg":
+		err = jpeg.Encode(&buf, dst, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-encode scaled %s: %w", outputFormat, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// applyPNGDPI inserts a pHYs chunk recording dpi (replacing any pHYs chunk
+// already present) so downstream tools such as LaTeX and Word honor the
+// image's physical size instead of assuming 96 DPI. It is a no-op when dpi
+// is unset or already the 96 DPI default.
+func applyPNGDPI(data []byte, dpi float64) ([]byte, error) {
+	if dpi <= 0 || dpi == defaultPNGDPI {
+		return data, nil
+	}
+
+	const pngSignatureLen = 8
+	if len(data) < pngSignatureLen {
+		return nil, fmt.Errorf("not a valid PNG: too short")
+	}
+
+	pixelsPerMeter := uint32(dpi / 0.0254)
+	physData := make([]byte, 9)
+	binary.BigEndian.PutUint32(physData[0:4], pixelsPerMeter)
+	binary.BigEndian.PutUint32(physData[4:8], pixelsPerMeter)
+	physData[8] = 1 // unit specifier: meter
+
+	physChunk := encodePNGChunk("pHYs", physData)
+
+	out := make([]byte, 0, len(data)+len(physChunk))
+	out = append(out, data[:pngSignatureLen]...)
+
+	rest := data[pngSignatureLen:]
+	for len(rest) >= 8 {
+		length := binary.BigEndian.Uint32(rest[0:4])
+		chunkType := string(rest[4:8])
+		end := 8 + int(length) + 4
+		if end > len(rest) {
+			return nil, fmt.Errorf("malformed PNG chunk %q", chunkType)
+		}
+
+		// Drop any existing pHYs chunk; ours replaces it below.
+		if chunkType == "pHYs" {
+			rest = rest[end:]
+			continue
+		}
+
+		out = append(out, rest[:end]...)
+		rest = rest[end:]
+
+		if chunkType == "IHDR" {
+			out = append(out, physChunk...)
+		}
+	}
+
+	return out, nil
+}
+
+// encodePNGChunk builds a complete PNG chunk (length, type, data, CRC32)
+// for chunkType and data.
+func encodePNGChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 0, 12+len(data))
+
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+	chunk = append(chunk, length...)
+	chunk = append(chunk, []byte(chunkType)...)
+	chunk = append(chunk, data...)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	crcBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(crcBytes, crc.Sum32())
+	chunk = append(chunk, crcBytes...)
+
+	return chunk
+}
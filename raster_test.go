@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode test PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestScaleRaster(t *testing.T) {
+	src := encodeTestPNG(t, 10, 20)
+
+	scaled, err := scaleRaster(src, "png", 2.0, "")
+	if err != nil {
+		t.Fatalf("scaleRaster() error = %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(scaled))
+	if err != nil {
+		t.Fatalf("failed to decode scaled PNG: %v", err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != 20 || bounds.Dy() != 40 {
+		t.Fatalf("scaleRaster() produced %dx%d, want 20x40", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func TestScaleRasterNoScaleIsNoOp(t *testing.T) {
+	src := encodeTestPNG(t, 10, 20)
+
+	out, err := scaleRaster(src, "png", 1.0, "")
+	if err != nil {
+		t.Fatalf("scaleRaster() error = %v", err)
+	}
+	if !bytes.Equal(out, src) {
+		t.Fatalf("scaleRaster() with scale 1.0 modified the input")
+	}
+}
+
+func TestApplyPNGDPI(t *testing.T) {
+	src := encodeTestPNG(t, 10, 20)
+
+	out, err := applyPNGDPI(src, 300)
+	if err != nil {
+		t.Fatalf("applyPNGDPI() error = %v", err)
+	}
+
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("applyPNGDPI() produced an invalid PNG: %v", err)
+	}
+
+	pixelsPerMeter, ok := findPHYsPixelsPerMeter(out)
+	if !ok {
+		t.Fatalf("applyPNGDPI() output has no pHYs chunk")
+	}
+	want := uint32(11811) // 300 / 0.0254 = 11811.02, truncated
+	if pixelsPerMeter != want {
+		t.Fatalf("pHYs pixels-per-meter = %d, want %d", pixelsPerMeter, want)
+	}
+}
+
+func TestApplyPNGDPIDefaultIsNoOp(t *testing.T) {
+	src := encodeTestPNG(t, 10, 20)
+
+	out, err := applyPNGDPI(src, defaultPNGDPI)
+	if err != nil {
+		t.Fatalf("applyPNGDPI() error = %v", err)
+	}
+	if !bytes.Equal(out, src) {
+		t.Fatalf("applyPNGDPI() at the default DPI modified the input")
+	}
+}
+
+// findPHYsPixelsPerMeter extracts the X-axis pixels-per-meter value from the
+// first pHYs chunk in a PNG byte stream, for asserting on applyPNGDPI's output.
+func findPHYsPixelsPerMeter(data []byte) (uint32, bool) {
+	const pngSignatureLen = 8
+	rest := data[pngSignatureLen:]
+	for len(rest) >= 8 {
+		length := binary.BigEndian.Uint32(rest[0:4])
+		chunkType := string(rest[4:8])
+		end := 8 + int(length) + 4
+		if end > len(rest) {
+			return 0, false
+		}
+		if chunkType == "pHYs" {
+			return binary.BigEndian.Uint32(rest[8:12]), true
+		}
+		rest = rest[end:]
+	}
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DiagramType identifies one of the diagram languages Kroki can render
+// (e.g. "mermaid", "plantuml", "graphviz").
+type DiagramType string
+
+// ImageFormat identifies one of the output formats Kroki can produce
+// (e.g. "svg", "png", "pdf").
+type ImageFormat string
+
+// diagramTypeOrder is the canonical, ordered list of diagram types this
+// server supports. It is the single source of truth: the lookup set and
+// GetSupportedDiagramTypes() are both derived from it.
+var diagramTypeOrder = []DiagramType{
+	"mermaid", "plantuml", "graphviz", "c4plantuml",
+	"excalidraw", "erd", "svgbob", "nomnoml", "wavedrom",
+	"blockdiag", "seqdiag", "actdiag", "nwdiag", "packetdiag",
+	"rackdiag", "umlet", "ditaa", "vega", "vegalite",
+	"bpmn", "bytefield", "d2", "dbml", "pikchr",
+	"structurizr", "symbolator", "tikz", "wireviz",
+}
+
+// imageFormatOrder is the canonical, ordered list of output formats this
+// server supports.
+var imageFormatOrder = []ImageFormat{"svg", "png", "pdf", "jpeg", "base64"}
+
+var supportedDiagramTypes = func() map[DiagramType]bool {
+	set := make(map[DiagramType]bool, len(diagramTypeOrder))
+	for _, t := range diagramTypeOrder {
+		set[t] = true
+	}
+	return set
+}()
+
+var supportedImageFormats = func() map[ImageFormat]bool {
+	set := make(map[ImageFormat]bool, len(imageFormatOrder))
+	for _, f := range imageFormatOrder {
+		set[f] = true
+	}
+	return set
+}()
+
+// diagramTypeExtensions maps source file extensions (lowercase, with the
+// leading dot) to the diagram type they represent, mirroring the kroki-cli
+// `convert` heuristics.
+var diagramTypeExtensions = map[string]DiagramType{
+	".mmd":        "mermaid",
+	".puml":       "plantuml",
+	".plantuml":   "plantuml",
+	".dot":        "graphviz",
+	".gv":         "graphviz",
+	".excalidraw": "excalidraw",
+	".er":         "erd",
+	".svgbob":     "svgbob",
+	".nomnoml":    "nomnoml",
+	".wavedrom":   "wavedrom",
+	".bpmn":       "bpmn",
+	".d2":         "d2",
+	".dbml":       "dbml",
+	".pikchr":     "pikchr",
+	".tikz":       "tikz",
+	".wireviz":    "wireviz",
+}
+
+// imageFormatExtensions maps output file extensions (lowercase, with the
+// leading dot) to the Kroki output format, including the .jpg -> jpeg alias.
+var imageFormatExtensions = map[string]ImageFormat{
+	".svg":  "svg",
+	".png":  "png",
+	".pdf":  "pdf",
+	".jpeg": "jpeg",
+	".jpg":  "jpeg",
+}
+
+// GetSupportedDiagramTypes returns every diagram type this server accepts,
+// in canonical order.
+func GetSupportedDiagramTypes() []DiagramType {
+	return append([]DiagramType(nil), diagramTypeOrder...)
+}
+
+// GetSupportedImageFormats returns every output format this server accepts,
+// in canonical order.
+func GetSupportedImageFormats() []ImageFormat {
+	return append([]ImageFormat(nil), imageFormatOrder...)
+}
+
+func diagramTypeNames() []string {
+	names := make([]string, len(diagramTypeOrder))
+	for i, t := range diagramTypeOrder {
+		names[i] = string(t)
+	}
+	return names
+}
+
+func imageFormatNames() []string {
+	names := make([]string, len(imageFormatOrder))
+	for i, f := range imageFormatOrder {
+		names[i] = string(f)
+	}
+	return names
+}
+
+// diagramTypeFromExtension infers a DiagramType from a source file's
+// extension (e.g. "diagram.puml" -> plantuml).
+func diagramTypeFromExtension(path string) (DiagramType, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	diagramType, ok := diagramTypeExtensions[ext]
+	return diagramType, ok
+}
+
+// imageFormatFromExtension infers an ImageFormat from an output file's
+// extension (e.g. "diagram.jpg" -> jpeg).
+func imageFormatFromExtension(path string) (ImageFormat, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	format, ok := imageFormatExtensions[ext]
+	return format, ok
+}